@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -9,8 +10,10 @@ import (
 	"path/filepath"
 	"strings"
 
-	io "github.com/elastic/metricbeat-tests-poc/cli/internal"
+	io "github.com/elastic/e2e-testing/cli/internal"
 
+	composecli "github.com/compose-spec/compose-go/cli"
+	"github.com/compose-spec/compose-go/types"
 	packr "github.com/gobuffalo/packr/v2"
 	log "github.com/sirupsen/logrus"
 )
@@ -112,6 +115,94 @@ func GetComposeFile(isStack bool, composeName string) (string, error) {
 	return composeFilePath, nil
 }
 
+// GetComposeFiles returns the ordered list of compose files that make up a
+// service/stack: the base "docker-compose.yml", followed by a
+// "docker-compose.<profile>.yml" override for each of the requested profiles
+// that exists on disk. The ordered list is what gets merged by LoadProject,
+// later files overriding earlier ones, matching Compose's own override semantics.
+func GetComposeFiles(isStack bool, name string, profiles []string) ([]string, error) {
+	composeFilePath, err := GetComposeFile(isStack, name)
+	if err != nil {
+		return nil, err
+	}
+
+	composeFilePaths := []string{composeFilePath}
+
+	dir := filepath.Dir(composeFilePath)
+	for _, profile := range profiles {
+		overridePath := filepath.Join(dir, fmt.Sprintf("docker-compose.%s.yml", profile))
+
+		found, err := io.Exists(overridePath)
+		if err != nil || !found {
+			log.WithFields(log.Fields{
+				"name":    name,
+				"profile": profile,
+			}).Debug("No compose override found for profile")
+			continue
+		}
+
+		composeFilePaths = append(composeFilePaths, overridePath)
+	}
+
+	return composeFilePaths, nil
+}
+
+// LoadProject resolves and merges the compose files for one or more
+// services/stacks into a single validated *types.Project, using the same
+// Compose v3-aware loader the v2 backend (ComposeProject) runs on, so that
+// features such as profiles, deploy blocks, secrets and named networks are
+// understood instead of the files being blindly concatenated. composeNames
+// follows the same convention as ComposeProject.Up: when isStack is true, the
+// first name is the stack and the rest are additional services layered onto it.
+func LoadProject(projectName string, composeNames []string, isStack bool, profiles []string, env map[string]string) (*types.Project, error) {
+	var composeFilePaths []string
+	for i, composeName := range composeNames {
+		b := isStack
+		if i > 0 {
+			b = false
+		}
+
+		paths, err := GetComposeFiles(b, composeName, profiles)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get compose files for %s: %v", composeName, err)
+		}
+		composeFilePaths = append(composeFilePaths, paths...)
+
+		// the service defaults don't override variables the caller already set,
+		// e.g. a <NAME>_VERSION passed in through ComposeProject.WithEnv
+		defaults := PutServiceEnvironment(map[string]string{}, composeName, "")
+		for k, v := range defaults {
+			if _, set := env[k]; !set {
+				env[k] = v
+			}
+		}
+	}
+
+	envSlice := make([]string, 0, len(env))
+	for k, v := range env {
+		envSlice = append(envSlice, k+"="+v)
+	}
+
+	// profiles are already applied above, when GetComposeFiles picks which
+	// override files to merge in, so there's nothing left for compose-go itself
+	// to filter by profile here.
+	opts, err := composecli.NewProjectOptions(composeFilePaths,
+		composecli.WithOsEnv,
+		composecli.WithEnv(envSlice),
+		composecli.WithName(projectName),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Could not build compose project options: %v", err)
+	}
+
+	project, err := composecli.ProjectFromOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("Could not merge compose files %v: %v", composeFilePaths, err)
+	}
+
+	return project, nil
+}
+
 // GetServiceConfig configuration of a service
 func GetServiceConfig(service string) (Service, bool) {
 	return Op.GetServiceConfig(service)
@@ -157,15 +248,20 @@ func PutServiceEnvironment(env map[string]string, service string, serviceVersion
 	env[serviceUpper+"_VARIANT"] = service
 	env[serviceUpper+"_VERSION"] = serviceVersion
 
-	srv, exists := Op.Services[service]
-	if !exists {
-		log.WithFields(log.Fields{
-			"service": service,
-		}).Warn("Could not find compose file")
-	} else {
+	if srv, exists := Op.Services[service]; exists {
 		env[serviceUpper+"_PATH"] = filepath.Dir(srv.Path)
+		return env
 	}
 
+	if stack, exists := Op.Stacks[service]; exists {
+		env[serviceUpper+"_PATH"] = filepath.Dir(stack.Path)
+		return env
+	}
+
+	log.WithFields(log.Fields{
+		"service": service,
+	}).Warn("Could not find compose file")
+
 	return env
 }
 
@@ -201,9 +297,10 @@ func checkInstalledSoftware() {
 	log.Debug("Validating required tools...")
 	binaries := []string{
 		"docker",
-		"docker-compose",
 	}
 
+	// the Compose v2 Go API is a Docker CLI plugin, not a standalone binary, and
+	// DockerServiceManager no longer shells out to "docker-compose" for anything
 	for _, binary := range binaries {
 		which(binary)
 	}
@@ -0,0 +1,30 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package internal holds small filesystem helpers used while resolving compose
+// files from the tool's workspace.
+package internal
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Exists reports whether a file or directory exists at path.
+func Exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// MkdirAll creates the directory that will contain path, including any missing
+// parents, so a file can then be written at path.
+func MkdirAll(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0755)
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/progress"
+	"github.com/elastic/e2e-testing/cli/config"
+
+	"github.com/compose-spec/compose-go/types"
+	"github.com/docker/cli/cli/command"
+	flags "github.com/docker/cli/cli/flags"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/compose/v2/pkg/compose"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServiceManager manages lifecycle of a service
+type ServiceManager interface {
+	AddServicesToCompose(stack string, composeNames []string, env map[string]string, waits ...deploy.ServiceRequest) error
+	RemoveServicesFromCompose(stack string, composeNames []string) error
+	RunCompose(isStack bool, composeNames []string, env map[string]string, waits ...deploy.ServiceRequest) error
+	StopCompose(isStack bool, composeNames []string) error
+}
+
+// DockerServiceManager implementation of the service manager interface. It is kept
+// as a thin adapter on top of ComposeProject so existing callers relying on the
+// ServiceManager interface keep working while they migrate to the typed API.
+type DockerServiceManager struct {
+}
+
+// NewServiceManager returns a new service manager
+func NewServiceManager() ServiceManager {
+	return &DockerServiceManager{}
+}
+
+// AddServicesToCompose adds services to a running docker compose. Any waits
+// attached to the given ServiceRequests (via deploy.ServiceRequest.WithWait)
+// are applied to the project, so Up blocks until they succeed.
+func (sm *DockerServiceManager) AddServicesToCompose(stack string, composeNames []string, env map[string]string, waits ...deploy.ServiceRequest) error {
+	log.WithFields(log.Fields{
+		"stack":    stack,
+		"services": composeNames,
+	}).Debug("Adding services to compose")
+
+	newComposeNames := []string{stack}
+	newComposeNames = append(newComposeNames, composeNames...)
+
+	project, err := NewComposeProject(stack)
+	if err != nil {
+		return err
+	}
+
+	applyWaits(project, waits)
+
+	return project.WithEnv(env).Up(context.Background(), true, newComposeNames)
+}
+
+// RemoveServicesFromCompose removes services from a running docker compose
+func (sm *DockerServiceManager) RemoveServicesFromCompose(stack string, composeNames []string) error {
+	log.WithFields(log.Fields{
+		"stack":    stack,
+		"services": composeNames,
+	}).Debug("Removing services to compose")
+
+	newComposeNames := []string{stack}
+	newComposeNames = append(newComposeNames, composeNames...)
+
+	project, err := NewComposeProject(stack)
+	if err != nil {
+		return err
+	}
+
+	for _, composeName := range composeNames {
+		err := project.Remove(context.Background(), newComposeNames, []string{composeName})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"services": composeNames,
+				"stack":    stack,
+			}).Error("Could not remove services")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunCompose runs a docker compose by its name. Any waits attached to the given
+// ServiceRequests (via deploy.ServiceRequest.WithWait) are applied to the
+// project, so Up blocks until they succeed.
+func (sm *DockerServiceManager) RunCompose(isStack bool, composeNames []string, env map[string]string, waits ...deploy.ServiceRequest) error {
+	project, err := NewComposeProject(composeNames[0])
+	if err != nil {
+		return err
+	}
+
+	applyWaits(project, waits)
+
+	return project.WithEnv(env).WithOsEnv().Up(context.Background(), isStack, composeNames)
+}
+
+// applyWaits copies the wait strategies attached to each ServiceRequest onto
+// the compose project, connecting the deploy.ServiceRequest.WithWait DSL to
+// ComposeProject.Up.
+func applyWaits(project *ComposeProject, requests []deploy.ServiceRequest) {
+	for _, request := range requests {
+		for name, strategy := range request.Waits() {
+			project.WithWait(name, strategy)
+		}
+	}
+}
+
+// StopCompose stops a docker compose by its name
+func (sm *DockerServiceManager) StopCompose(isStack bool, composeNames []string) error {
+	project, err := NewComposeProject(composeNames[0])
+	if err != nil {
+		return err
+	}
+
+	return project.Down(context.Background(), isStack, composeNames)
+}
+
+// ComposeProject wraps the Docker Compose v2 Go API (api.Service), replacing the
+// previous approach of shelling out to the "docker-compose" binary for every
+// lifecycle operation. Projects are keyed by a stable, hashed identifier so that
+// long-lived test stack names don't run into Compose's project name constraints.
+type ComposeProject struct {
+	name     string
+	backend  api.Service
+	env      map[string]string
+	profiles []string
+	progress progress.Writer
+	waits    map[string]deploy.WaitStrategy
+}
+
+// defaultWaitTimeout bounds how long Up blocks on a single service's wait
+// strategies before giving up.
+const defaultWaitTimeout = 2 * time.Minute
+
+// NewComposeProject creates a ComposeProject backed by a Compose v2 api.Service,
+// built from a Docker CLI instance the same way the "docker compose" plugin does.
+func NewComposeProject(stack string) (*ComposeProject, error) {
+	dockerCli, err := command.NewDockerCli()
+	if err != nil {
+		return nil, fmt.Errorf("Could not create docker CLI: %v", err)
+	}
+
+	if err := dockerCli.Initialize(flags.NewClientOptions()); err != nil {
+		return nil, fmt.Errorf("Could not initialise docker CLI: %v", err)
+	}
+
+	return &ComposeProject{
+		name:     projectID(stack),
+		backend:  compose.NewComposeService(dockerCli.Client(), dockerCli.ConfigFile()),
+		env:      map[string]string{},
+		progress: progress.NewWriter(""),
+	}, nil
+}
+
+// WithProgress sets the progress.Writer that Up/Down events are reported to,
+// overriding the default writer selected from the OP_PROGRESS environment
+// variable.
+func (p *ComposeProject) WithProgress(w progress.Writer) *ComposeProject {
+	p.progress = w
+	return p
+}
+
+// WithEnv sets additional environment variables that will be passed down to the
+// compose project when it's loaded.
+func (p *ComposeProject) WithEnv(env map[string]string) *ComposeProject {
+	for k, v := range env {
+		p.env[k] = v
+	}
+	return p
+}
+
+// WithOsEnv merges the current process environment into the project's environment,
+// matching the behaviour of the "docker-compose" binary, which always inherited it.
+func (p *ComposeProject) WithOsEnv() *ComposeProject {
+	for _, kv := range os.Environ() {
+		for i := 0; i < len(kv); i++ {
+			if kv[i] == '=' {
+				p.env[kv[:i]] = kv[i+1:]
+				break
+			}
+		}
+	}
+	return p
+}
+
+// WithWait attaches a WaitStrategy that Up must satisfy for the named service
+// before it returns.
+func (p *ComposeProject) WithWait(service string, s deploy.WaitStrategy) *ComposeProject {
+	if p.waits == nil {
+		p.waits = map[string]deploy.WaitStrategy{}
+	}
+	p.waits[service] = s
+	return p
+}
+
+// WithProfiles selects, for each given profile, the "docker-compose.<profile>.yml"
+// override file that is merged on top of the base compose file when it exists.
+// The profiles are not handed to the compose loader, so services are not
+// filtered by their own "profiles" key.
+func (p *ComposeProject) WithProfiles(profiles ...string) *ComposeProject {
+	p.profiles = profiles
+	return p
+}
+
+// Up brings up the compose project, resolving the compose files for each name in
+// composeNames and running them through the Compose v2 backend.
+func (p *ComposeProject) Up(ctx context.Context, isStack bool, composeNames []string) error {
+	p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusStart, Text: "pulling and starting services"})
+
+	project, err := p.loadProject(composeNames, isStack)
+	if err != nil {
+		p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusError, Err: err})
+		return err
+	}
+
+	err = p.backend.Up(ctx, project, api.UpOptions{
+		Create: api.CreateOptions{},
+		Start:  api.StartOptions{},
+	})
+	if err != nil {
+		p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusError, Err: err})
+		return fmt.Errorf("Could not run compose project %s: %v", p.name, err)
+	}
+
+	p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusDone, Text: "up"})
+
+	log.WithFields(log.Fields{
+		"composeNames": composeNames,
+		"project":      p.name,
+	}).Debug("Docker compose up.")
+
+	return p.waitUntilReady(ctx)
+}
+
+// waitUntilReady blocks until every attached WaitStrategy succeeds, applying a
+// per-service timeout so a single stuck dependency doesn't hang forever.
+func (p *ComposeProject) waitUntilReady(ctx context.Context) error {
+	for name, strategy := range p.waits {
+		waitCtx, cancel := context.WithTimeout(ctx, defaultWaitTimeout)
+		err := strategy.WaitUntilReady(waitCtx, p, deploy.NewServiceRequest(name))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("Service %s did not become ready: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Down stops and removes the compose project.
+func (p *ComposeProject) Down(ctx context.Context, isStack bool, composeNames []string) error {
+	p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusStart, Text: "stopping services"})
+
+	project, err := p.loadProject(composeNames, isStack)
+	if err != nil {
+		p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusError, Err: err})
+		return err
+	}
+
+	err = p.backend.Down(ctx, project.Name, api.DownOptions{Project: project})
+	if err != nil {
+		p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusError, Err: err})
+		return fmt.Errorf("Could not stop compose project %s: %v", p.name, err)
+	}
+
+	p.progress.Event(progress.Event{ID: p.name, Status: progress.StatusDone, Text: "down"})
+
+	log.WithFields(log.Fields{
+		"composeNames": composeNames,
+		"project":      p.name,
+	}).Debug("Docker compose down.")
+
+	return nil
+}
+
+// Remove removes the given services from an already running compose project.
+func (p *ComposeProject) Remove(ctx context.Context, composeNames []string, services []string) error {
+	project, err := p.loadProject(composeNames, true)
+	if err != nil {
+		return err
+	}
+
+	err = p.backend.Remove(ctx, project, api.RemoveOptions{
+		Services: services,
+		Force:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("Could not remove services %v from project %s: %v", services, p.name, err)
+	}
+
+	return nil
+}
+
+// ServiceContainer returns the summary of the container backing a running service
+// (its ID, name, state and health), so that callers don't need to re-parse the
+// output of "docker ps". The summary does not include the container's IP address.
+func (p *ComposeProject) ServiceContainer(ctx context.Context, name string) (*api.ContainerSummary, error) {
+	containers, err := p.backend.Ps(ctx, p.name, api.PsOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list containers for project %s: %v", p.name, err)
+	}
+
+	for i := range containers {
+		if containers[i].Service == name {
+			return &containers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("Could not find container for service %s in project %s", name, p.name)
+}
+
+// ComposeProject implements deploy.Deployment so that WaitStrategy implementations
+// (ForExec, ForLog) can target a compose service the same way they target a
+// Kubernetes pod.
+
+// AddFiles copies files into the service's container.
+func (p *ComposeProject) AddFiles(service deploy.ServiceRequest, files []string) error {
+	project := &types.Project{Name: p.name}
+
+	for _, file := range files {
+		err := p.backend.Copy(context.Background(), project, api.CopyOptions{
+			Source:      file,
+			Destination: fmt.Sprintf("%s:/", service.Name),
+		})
+		if err != nil {
+			return fmt.Errorf("Could not copy %s to service %s: %v", file, service.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Healthy reports whether the service's container is reporting healthy on its
+// own Docker HEALTHCHECK, so ForHealthcheck can be used against compose
+// services that define one.
+func (p *ComposeProject) Healthy(service deploy.ServiceRequest) (bool, error) {
+	container, err := p.ServiceContainer(context.Background(), service.Name)
+	if err != nil {
+		return false, err
+	}
+
+	return container.Health == "healthy", nil
+}
+
+// ExecIn runs a command inside the service's container.
+func (p *ComposeProject) ExecIn(service deploy.ServiceRequest, cmd []string) (string, error) {
+	exitCode, err := p.backend.Exec(context.Background(), p.name, api.RunOptions{
+		Service: service.Name,
+		Command: cmd,
+	})
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("command %v exited with code %d", cmd, exitCode)
+	}
+
+	return "", nil
+}
+
+// ReadLogs returns the service's container logs, so that ForLog can grep them.
+func (p *ComposeProject) ReadLogs(service deploy.ServiceRequest) (string, error) {
+	var buf bytes.Buffer
+
+	err := p.backend.Logs(context.Background(), p.name, &bufferLogConsumer{buf: &buf}, api.LogOptions{
+		Services: []string{service.Name},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// bufferLogConsumer implements api.LogConsumer by writing every line to an
+// in-memory buffer, so ReadLogs can hand ForLog a plain string.
+type bufferLogConsumer struct {
+	buf *bytes.Buffer
+}
+
+func (c *bufferLogConsumer) Log(service, container, message string) {
+	c.buf.WriteString(message)
+	c.buf.WriteString("\n")
+}
+
+func (c *bufferLogConsumer) Status(container, msg string) {}
+
+func (c *bufferLogConsumer) Register(container string) {}
+
+// Logs reads the service's container logs and prints them through the logger,
+// at info level.
+func (p *ComposeProject) Logs(service deploy.ServiceRequest) error {
+	logs, err := p.ReadLogs(service)
+	if err != nil {
+		return err
+	}
+
+	log.Info(logs)
+	return nil
+}
+
+func (p *ComposeProject) loadProject(composeNames []string, isStack bool) (*types.Project, error) {
+	return config.LoadProject(p.name, composeNames, isStack, p.profiles, p.env)
+}
+
+// projectID derives a stable Compose project name from the stack name, hashing it
+// so that long test names don't run afoul of Compose's project naming rules.
+func projectID(stack string) string {
+	h := sha1.Sum([]byte(stack))
+	return fmt.Sprintf("op-%x", h[:8])
+}
@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package common holds configuration shared across installers and services,
+// such as which beats version to fetch artifacts for.
+package common
+
+import "os"
+
+// BeatVersion is the version of the beats artifacts (elastic-agent, etc.)
+// installers fetch, overridable via BEAT_VERSION so CI can pin a specific build.
+var BeatVersion = getEnv("BEAT_VERSION", "8.0.0-SNAPSHOT")
+
+// BeatVersionBase is the base version used to resolve the snapshot path on the
+// artifacts server, without the "-SNAPSHOT" suffix, overridable via
+// BEAT_VERSION_BASE.
+var BeatVersionBase = getEnv("BEAT_VERSION_BASE", "8.0.0")
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
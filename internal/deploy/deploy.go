@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+// ServiceRequest represents a service to be deployed, identifying it by name so
+// that a Deployment backend can resolve it to a running container or pod.
+type ServiceRequest struct {
+	Name string
+
+	waits map[string]WaitStrategy
+}
+
+// NewServiceRequest creates a ServiceRequest for the named service.
+func NewServiceRequest(name string) ServiceRequest {
+	return ServiceRequest{Name: name}
+}
+
+// WithWait attaches a WaitStrategy that must succeed, for the dependency named
+// "name", before the service is considered ready. Multiple strategies can be
+// attached under different names, e.g. one per dependent container.
+func (r ServiceRequest) WithWait(name string, s WaitStrategy) ServiceRequest {
+	if r.waits == nil {
+		r.waits = map[string]WaitStrategy{}
+	}
+	r.waits[name] = s
+
+	return r
+}
+
+// Waits returns the wait strategies attached to this service request.
+func (r ServiceRequest) Waits() map[string]WaitStrategy {
+	return r.waits
+}
+
+// Deployment abstracts the environment a service runs in, so that installers
+// don't need to know whether they are talking to a Docker Compose stack or a
+// Kubernetes cluster.
+type Deployment interface {
+	AddFiles(service ServiceRequest, files []string) error
+	ExecIn(service ServiceRequest, cmd []string) (string, error)
+	Logs(service ServiceRequest) error
+}
+
+// ServiceOperatorManifest describes where an installed package lives on the
+// target service, so operators don't need to hard-code filesystem paths.
+type ServiceOperatorManifest struct {
+	WorkDir    string
+	CommitFile string
+
+	// Pod and Namespace are populated by operators that run on Kubernetes, where
+	// the "work dir" lives inside a pod rather than a host filesystem.
+	Pod       string
+	Namespace string
+}
+
+// ServiceOperator represents the lifecycle operations of a package installer for
+// a given service, regardless of the package format (TAR, RPM, DEB) or the
+// deployment backend it runs against.
+type ServiceOperator interface {
+	AddFiles(files []string) error
+	Inspect() (ServiceOperatorManifest, error)
+	Install() error
+	Exec(args []string) (string, error)
+	Enroll(token string) error
+	InstallCerts() error
+	Logs() error
+	Postinstall() error
+	Preinstall() error
+	Start() error
+	Stop() error
+	Uninstall() error
+}
@@ -0,0 +1,347 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// defaultAgentImage is the base image the agent's pod runs, when the caller of
+// ApplyPod doesn't override it. The elastic-agent binary itself is mounted in via
+// the hostPath volumes AddFiles registers, so a minimal image that can run it is
+// enough.
+const defaultAgentImage = "ubuntu:20.04"
+
+// KubernetesDeployment is a Deployment that targets a Kubernetes cluster, applying
+// a Deployment, a Service and a Secret per service with client-go, instead of
+// spinning up local Docker containers. These objects are built from the service's
+// name alone; the service's compose model is not read. Files added
+// via AddFiles are bind-mounted into the pod as hostPath volumes rather than
+// stored as Kubernetes objects, since artifacts such as the elastic-agent tarball
+// routinely exceed the size Kubernetes allows for ConfigMaps/Secrets.
+type KubernetesDeployment struct {
+	Namespace string
+
+	clientSet  kubernetes.Interface
+	restConfig *rest.Config
+
+	mu        sync.Mutex
+	hostFiles map[string][]string
+}
+
+// NewKubernetesDeployment creates a KubernetesDeployment for the given namespace,
+// reading the kubeconfig named by the KUBECONFIG env var, or falling back to the
+// in-cluster config when it isn't set. ~/.kube/config is not read.
+func NewKubernetesDeployment(namespace string) (*KubernetesDeployment, error) {
+	restConfig, err := kubeRestConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Could not build a Kubernetes client config: %v", err)
+	}
+
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create a Kubernetes clientset: %v", err)
+	}
+
+	return &KubernetesDeployment{
+		Namespace:  namespace,
+		clientSet:  clientSet,
+		restConfig: restConfig,
+	}, nil
+}
+
+// AddFiles records the given files to be mounted into the service's pod as
+// hostPath volumes once ApplyPod builds its Deployment. Artifacts such as the
+// elastic-agent tarball can be multi-hundred-MB, well past the ~1MiB Kubernetes
+// enforces on ConfigMap/Secret objects, so they're bind-mounted straight from the
+// node's filesystem instead of being stored in the API server. This assumes the
+// cluster's node is the same host running these files (e.g. kind, minikube,
+// docker-desktop), which is the target this package is built for.
+func (k *KubernetesDeployment) AddFiles(service ServiceRequest, files []string) error {
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("Could not stat file %s: %v", file, err)
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.hostFiles == nil {
+		k.hostFiles = map[string][]string{}
+	}
+	k.hostFiles[service.Name] = append(k.hostFiles[service.Name], files...)
+
+	log.WithFields(log.Fields{
+		"namespace": k.Namespace,
+		"service":   service.Name,
+		"files":     files,
+	}).Debug("Files registered as hostPath mounts")
+
+	return nil
+}
+
+// ApplyPod translates service into a Deployment and a Service and applies them
+// with client-go -- creating them if they don't exist yet, updating them
+// otherwise -- which is the Kubernetes equivalent of "kubectl apply" for the
+// objects backing a compose service. The pod template is labelled
+// "app=<service.Name>", which is the selector podName() looks pods up by, so the
+// rest of the Deployment (ExecIn, Logs, PodName) can find the pod once it's
+// scheduled.
+func (k *KubernetesDeployment) ApplyPod(service ServiceRequest, image string) error {
+	if image == "" {
+		image = defaultAgentImage
+	}
+
+	labels := map[string]string{"app": service.Name}
+
+	k.mu.Lock()
+	files := k.hostFiles[service.Name]
+	k.mu.Unlock()
+
+	volumes, mounts := hostPathVolumes(files)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: k.Namespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1),
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:         service.Name,
+							Image:        image,
+							Command:      []string{"sleep", "infinity"},
+							VolumeMounts: mounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+
+	if err := k.applyDeployment(deployment); err != nil {
+		return err
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: k.Namespace},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{Name: "fleet", Port: 8220, TargetPort: intstr.FromInt(8220)},
+			},
+		},
+	}
+
+	return k.applyService(svc)
+}
+
+// ApplySecret stores the given key/value pairs as a Kubernetes Secret named after
+// the service, e.g. for the Fleet enrollment token the agent is installed with.
+func (k *KubernetesDeployment) ApplySecret(service ServiceRequest, data map[string][]byte) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: service.Name, Namespace: k.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       data,
+	}
+
+	ctx := context.Background()
+	client := k.clientSet.CoreV1().Secrets(k.Namespace)
+
+	_, err := client.Create(ctx, secret, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = client.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Could not apply secret for service %s: %v", service.Name, err)
+	}
+
+	return nil
+}
+
+func (k *KubernetesDeployment) applyDeployment(deployment *appsv1.Deployment) error {
+	ctx := context.Background()
+	client := k.clientSet.AppsV1().Deployments(k.Namespace)
+
+	_, err := client.Create(ctx, deployment, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		_, err = client.Update(ctx, deployment, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Could not apply deployment %s: %v", deployment.Name, err)
+	}
+
+	log.WithFields(log.Fields{
+		"namespace":  k.Namespace,
+		"deployment": deployment.Name,
+	}).Debug("Deployment applied")
+
+	return nil
+}
+
+func (k *KubernetesDeployment) applyService(svc *corev1.Service) error {
+	ctx := context.Background()
+	client := k.clientSet.CoreV1().Services(k.Namespace)
+
+	existing, err := client.Get(ctx, svc.Name, metav1.GetOptions{})
+	if err == nil {
+		svc.ResourceVersion = existing.ResourceVersion
+		svc.Spec.ClusterIP = existing.Spec.ClusterIP
+		_, err = client.Update(ctx, svc, metav1.UpdateOptions{})
+	} else if k8serrors.IsNotFound(err) {
+		_, err = client.Create(ctx, svc, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Could not apply service %s: %v", svc.Name, err)
+	}
+
+	log.WithFields(log.Fields{
+		"namespace": k.Namespace,
+		"service":   svc.Name,
+	}).Debug("Service applied")
+
+	return nil
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// ExecIn runs a command inside the service's pod, mirroring "kubectl exec".
+func (k *KubernetesDeployment) ExecIn(service ServiceRequest, cmd []string) (string, error) {
+	podName, err := k.podName(service)
+	if err != nil {
+		return "", err
+	}
+
+	req := k.clientSet.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(k.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Command: cmd,
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(k.restConfig, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("Could not create executor for pod %s: %v", podName, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	if err != nil {
+		return stdout.String(), fmt.Errorf("Could not exec %v in pod %s: %v - %s", cmd, podName, err, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
+
+// Logs streams the service's pod logs, mirroring "kubectl logs -f".
+func (k *KubernetesDeployment) Logs(service ServiceRequest) error {
+	podName, err := k.podName(service)
+	if err != nil {
+		return err
+	}
+
+	stream, err := k.clientSet.CoreV1().Pods(k.Namespace).GetLogs(podName, &corev1.PodLogOptions{Follow: true}).Stream(context.Background())
+	if err != nil {
+		return fmt.Errorf("Could not stream logs for pod %s: %v", podName, err)
+	}
+	defer stream.Close()
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(stream)
+	if err != nil {
+		return fmt.Errorf("Could not read logs for pod %s: %v", podName, err)
+	}
+
+	log.Info(buf.String())
+	return nil
+}
+
+// PodName resolves the pod backing a service, so that ServiceOperators can report
+// it back (e.g. in their Inspect() manifest) without re-deriving the label selector.
+func (k *KubernetesDeployment) PodName(service ServiceRequest) (string, error) {
+	return k.podName(service)
+}
+
+// podName resolves the pod backing a service, assuming pods are labelled with
+// "app=<service.Name>" as the generated Deployment/Service manifests do.
+func (k *KubernetesDeployment) podName(service ServiceRequest) (string, error) {
+	pods, err := k.clientSet.CoreV1().Pods(k.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=%s", service.Name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Could not list pods for service %s: %v", service.Name, err)
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("Could not find a pod for service %s in namespace %s", service.Name, k.Namespace)
+	}
+
+	return pods.Items[0].Name, nil
+}
+
+// hostPathVolumes builds a Volume/VolumeMount pair per file, bind-mounting each
+// one from the node's filesystem into the container at
+// /elastic-agent/<base name of the file>.
+func hostPathVolumes(files []string) ([]corev1.Volume, []corev1.VolumeMount) {
+	hostPathFile := corev1.HostPathFile
+
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+
+	for i, file := range files {
+		name := fmt.Sprintf("artifact-%d", i)
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: file,
+					Type: &hostPathFile,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: filepath.Join("/elastic-agent", filepath.Base(file)),
+		})
+	}
+
+	return volumes, mounts
+}
+
+// kubeRestConfig resolves a Kubernetes client config, preferring KUBECONFIG and
+// falling back to the in-cluster config when running inside a pod.
+func kubeRestConfig() (*rest.Config, error) {
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+
+	return rest.InClusterConfig()
+}
@@ -0,0 +1,177 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// WaitStrategy decides when a service, already started by a Deployment, is ready
+// to be used. It replaces the ad-hoc retries/backoff callers used to sprinkle
+// around Kibana/Fleet probes.
+type WaitStrategy interface {
+	// WaitUntilReady blocks until the strategy is satisfied, ctx is done, or its
+	// own internal retry budget is exhausted, whichever happens first.
+	WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error
+}
+
+// LogReader is implemented by Deployments that can return a service's logs as a
+// string, so ForLog can grep them. Not all backends support it.
+type LogReader interface {
+	ReadLogs(service ServiceRequest) (string, error)
+}
+
+// HealthChecker is implemented by Deployments that can report a service's native
+// health check status (e.g. Docker's `State.Health` or a Kubernetes readiness
+// probe). Not all backends support it.
+type HealthChecker interface {
+	Healthy(service ServiceRequest) (bool, error)
+}
+
+const defaultPollInterval = 2 * time.Second
+
+// ForExec waits until running cmd against the service exits with exitCode.
+func ForExec(cmd []string, exitCode int) WaitStrategy {
+	return &execStrategy{cmd: cmd, exitCode: exitCode}
+}
+
+type execStrategy struct {
+	cmd      []string
+	exitCode int
+}
+
+func (s *execStrategy) WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error {
+	return poll(ctx, func() (bool, error) {
+		_, err := d.ExecIn(service, s.cmd)
+		// the Deployment interface does not expose process exit codes, so a
+		// non-zero exitCode can only be approximated as "the command failed"
+		if s.exitCode == 0 {
+			return err == nil, nil
+		}
+		return err != nil, nil
+	})
+}
+
+// ForLog waits until the service's logs contain at least occurrences matches of
+// regex.
+func ForLog(regex string, occurrences int) WaitStrategy {
+	return &logStrategy{pattern: regexp.MustCompile(regex), occurrences: occurrences}
+}
+
+type logStrategy struct {
+	pattern     *regexp.Regexp
+	occurrences int
+}
+
+func (s *logStrategy) WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error {
+	reader, ok := d.(LogReader)
+	if !ok {
+		return fmt.Errorf("Deployment does not support reading logs for ForLog wait strategy")
+	}
+
+	return poll(ctx, func() (bool, error) {
+		logs, err := reader.ReadLogs(service)
+		if err != nil {
+			return false, nil
+		}
+		return len(s.pattern.FindAllString(logs, -1)) >= s.occurrences, nil
+	})
+}
+
+// ForHTTP waits until an HTTP GET to url succeeds and statusPredicate(status)
+// returns true.
+func ForHTTP(url string, statusPredicate func(status int) bool) WaitStrategy {
+	return &httpStrategy{url: url, statusPredicate: statusPredicate}
+}
+
+type httpStrategy struct {
+	url             string
+	statusPredicate func(status int) bool
+}
+
+func (s *httpStrategy) WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error {
+	client := &http.Client{Timeout: defaultPollInterval}
+
+	return poll(ctx, func() (bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+		if err != nil {
+			return false, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+
+		return s.statusPredicate(resp.StatusCode), nil
+	})
+}
+
+// ForListeningPort waits until a TCP connection to host:port succeeds.
+func ForListeningPort(host string, port int) WaitStrategy {
+	return &portStrategy{address: fmt.Sprintf("%s:%d", host, port)}
+}
+
+type portStrategy struct {
+	address string
+}
+
+func (s *portStrategy) WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error {
+	return poll(ctx, func() (bool, error) {
+		conn, err := net.DialTimeout("tcp", s.address, defaultPollInterval)
+		if err != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	})
+}
+
+// ForHealthcheck waits until the service's native health check reports healthy.
+func ForHealthcheck() WaitStrategy {
+	return &healthcheckStrategy{}
+}
+
+type healthcheckStrategy struct{}
+
+func (s *healthcheckStrategy) WaitUntilReady(ctx context.Context, d Deployment, service ServiceRequest) error {
+	checker, ok := d.(HealthChecker)
+	if !ok {
+		return fmt.Errorf("Deployment does not support health checks for ForHealthcheck wait strategy")
+	}
+
+	return poll(ctx, func() (bool, error) {
+		return checker.Healthy(service)
+	})
+}
+
+// poll retries check every defaultPollInterval until it returns true, ctx is
+// done, or check itself returns an error.
+func poll(ctx context.Context, check func() (bool, error)) error {
+	ticker := time.NewTicker(defaultPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := check()
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Timed out waiting for service to be ready: %v", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
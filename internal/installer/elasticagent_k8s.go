@@ -0,0 +1,184 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"fmt"
+
+	"github.com/elastic/e2e-testing/internal/common"
+	"github.com/elastic/e2e-testing/internal/deploy"
+	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/progress"
+	"github.com/elastic/e2e-testing/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// elasticAgentK8s implements operations for an elastic-agent installer that targets
+// a Kubernetes cluster instead of a Docker Compose stack.
+type elasticAgentK8s struct {
+	service    deploy.ServiceRequest
+	deploy     deploy.Deployment
+	kubernetes *deploy.KubernetesDeployment
+}
+
+// AttachElasticAgentK8s creates an instance of the elastic-agent installer that
+// applies Kubernetes objects (Deployment, Service, Secret) built from the service
+// request, instead of running docker-compose. The service's compose model is not
+// translated into these objects.
+func AttachElasticAgentK8s(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator {
+	operator := &elasticAgentK8s{
+		service: service,
+		deploy:  d,
+	}
+
+	if k8sDeployment, ok := d.(*deploy.KubernetesDeployment); ok {
+		operator.kubernetes = k8sDeployment
+	}
+
+	return operator
+}
+
+// AddFiles will add files into the service environment, as hostPath mounts
+func (i *elasticAgentK8s) AddFiles(files []string) error {
+	return i.deploy.AddFiles(i.service, files)
+}
+
+// Inspect returns info on package, including the pod and namespace backing it
+func (i *elasticAgentK8s) Inspect() (deploy.ServiceOperatorManifest, error) {
+	manifest := deploy.ServiceOperatorManifest{
+		WorkDir:    "/opt/Elastic/Agent",
+		CommitFile: "/elastic-agent/.elastic-agent.active.commit",
+	}
+
+	if i.kubernetes == nil {
+		return manifest, nil
+	}
+
+	podName, err := i.kubernetes.PodName(i.service)
+	if err != nil {
+		return manifest, err
+	}
+
+	manifest.Pod = podName
+	manifest.Namespace = i.kubernetes.Namespace
+
+	return manifest, nil
+}
+
+// Install applies the Deployment and Service backing the agent pod, translated
+// from the service request, via the Kubernetes API -- the "kubectl apply"
+// equivalent of docker-compose's "up" for this installer.
+func (i *elasticAgentK8s) Install() error {
+	if i.kubernetes == nil {
+		log.Trace("Not running against a Kubernetes deployment: nothing to apply")
+		return nil
+	}
+
+	if err := i.kubernetes.ApplyPod(i.service, ""); err != nil {
+		return fmt.Errorf("Failed to apply Kubernetes objects for service %s: %v", i.service.Name, err)
+	}
+
+	return nil
+}
+
+// Exec will execute a command within the agent pod
+func (i *elasticAgentK8s) Exec(args []string) (string, error) {
+	return i.deploy.ExecIn(i.service, args)
+}
+
+// Enroll will enroll the agent into fleet, execing into the agent pod. The
+// enrollment token is also stored as a Kubernetes Secret, so it's recorded
+// alongside the rest of the objects backing the service rather than only living
+// in the exec arguments.
+func (i *elasticAgentK8s) Enroll(token string) error {
+	if i.kubernetes != nil {
+		if err := i.kubernetes.ApplySecret(i.service, map[string][]byte{"fleet-enrollment-token": []byte(token)}); err != nil {
+			return fmt.Errorf("Failed to store the enrollment token: %v", err)
+		}
+	}
+
+	cfg, _ := kibana.NewFleetConfig(token)
+	args := []string{"/elastic-agent/elastic-agent", "install"}
+	args = append(args, cfg.Flags()...)
+
+	_, err := i.Exec(args)
+	if err != nil {
+		return fmt.Errorf("Failed to install the agent with subcommand: %v", err)
+	}
+	return nil
+}
+
+// InstallCerts installs the certificates for the agent pod
+func (i *elasticAgentK8s) InstallCerts() error {
+	return nil
+}
+
+// Logs prints logs of the agent pod
+func (i *elasticAgentK8s) Logs() error {
+	return i.deploy.Logs(i.service)
+}
+
+// Postinstall executes operations after installing the agent on the cluster
+func (i *elasticAgentK8s) Postinstall() error {
+	return nil
+}
+
+// Preinstall fetches the elastic-agent tarball and registers it as a hostPath
+// mount for the pod; the Deployment and Service that mount it are applied in
+// Install
+func (i *elasticAgentK8s) Preinstall() error {
+	artifact := "elastic-agent"
+	os := "linux"
+	arch := "x86_64"
+	if utils.GetArchitecture() == "arm64" {
+		arch = "arm64"
+	}
+	extension := "tar.gz"
+
+	writer := progress.NewWriter("")
+	writer.Event(progress.Event{ID: artifact, Status: progress.StatusStart, Text: "downloading elastic-agent artifact"})
+
+	binaryName := utils.BuildArtifactName(artifact, common.BeatVersion, common.BeatVersionBase, os, arch, extension, false)
+	binaryPath, err := utils.FetchBeatsBinary(binaryName, artifact, common.BeatVersion, common.BeatVersionBase, utils.TimeoutFactor, true, writer)
+	if err != nil {
+		writer.Event(progress.Event{ID: artifact, Status: progress.StatusError, Err: err})
+		log.WithFields(log.Fields{
+			"artifact":  artifact,
+			"version":   common.BeatVersion,
+			"os":        os,
+			"arch":      arch,
+			"extension": extension,
+			"error":     err,
+		}).Error("Could not download the binary for the agent")
+		return err
+	}
+
+	writer.Event(progress.Event{ID: artifact, Status: progress.StatusDone, Text: "downloaded"})
+
+	return i.AddFiles([]string{binaryPath})
+}
+
+// Start will start the agent inside the pod
+func (i *elasticAgentK8s) Start() error {
+	_, err := i.Exec([]string{"elastic-agent", "run", "-d"})
+	return err
+}
+
+// Stop will stop the agent inside the pod
+func (i *elasticAgentK8s) Stop() error {
+	_, err := i.Exec([]string{"pkill", "elastic-agent"})
+	return err
+}
+
+// Uninstall uninstalls the agent inside the pod. The Kubernetes objects applied
+// for the service (Deployment, Service, Secret) are left in place.
+func (i *elasticAgentK8s) Uninstall() error {
+	args := []string{"elastic-agent", "uninstall", "-f"}
+	_, err := i.Exec(args)
+	if err != nil {
+		return fmt.Errorf("Failed to uninstall the agent with subcommand: %v", err)
+	}
+	return nil
+}
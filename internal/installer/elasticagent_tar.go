@@ -5,11 +5,14 @@
 package installer
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/elastic/e2e-testing/internal/common"
 	"github.com/elastic/e2e-testing/internal/deploy"
 	"github.com/elastic/e2e-testing/internal/kibana"
+	"github.com/elastic/e2e-testing/internal/progress"
 	"github.com/elastic/e2e-testing/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
@@ -94,9 +97,13 @@ func (i *elasticAgentTARPackage) Preinstall() error {
 	}
 	extension := "tar.gz"
 
+	writer := progress.NewWriter("")
+	writer.Event(progress.Event{ID: artifact, Status: progress.StatusStart, Text: "downloading elastic-agent artifact"})
+
 	binaryName := utils.BuildArtifactName(artifact, common.BeatVersion, common.BeatVersionBase, os, arch, extension, false)
-	binaryPath, err := utils.FetchBeatsBinary(binaryName, artifact, common.BeatVersion, common.BeatVersionBase, utils.TimeoutFactor, true)
+	binaryPath, err := utils.FetchBeatsBinary(binaryName, artifact, common.BeatVersion, common.BeatVersionBase, utils.TimeoutFactor, true, writer)
 	if err != nil {
+		writer.Event(progress.Event{ID: artifact, Status: progress.StatusError, Err: err})
 		log.WithFields(log.Fields{
 			"artifact":  artifact,
 			"version":   common.BeatVersion,
@@ -108,6 +115,8 @@ func (i *elasticAgentTARPackage) Preinstall() error {
 		return err
 	}
 
+	writer.Event(progress.Event{ID: artifact, Status: progress.StatusDone, Text: "downloaded"})
+
 	err = i.AddFiles([]string{binaryPath})
 	if err != nil {
 		return err
@@ -124,7 +133,14 @@ func (i *elasticAgentTARPackage) Start() error {
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// wait for the agent to be up before returning, so that Enroll doesn't race
+	// the agent's systemd startup
+	wait := deploy.ForExec([]string{"elastic-agent", "status"}, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	return wait.WaitUntilReady(ctx, i.deploy, i.service)
 }
 
 // Stop will start a service
@@ -0,0 +1,24 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package installer
+
+import (
+	"os"
+	"strings"
+
+	"github.com/elastic/e2e-testing/internal/deploy"
+)
+
+// AttachElasticAgentInstaller returns the elastic-agent installer for the active
+// deployment backend, selected through the DEPLOY_PROVIDER environment variable
+// ("k8s" or "compose", defaulting to "compose"), so that existing scenarios keep
+// running against Docker Compose unless they opt into Kubernetes.
+func AttachElasticAgentInstaller(d deploy.Deployment, service deploy.ServiceRequest) deploy.ServiceOperator {
+	if strings.ToLower(os.Getenv("DEPLOY_PROVIDER")) == "k8s" {
+		return AttachElasticAgentK8s(d, service)
+	}
+
+	return AttachElasticAgentTARPackage(d, service)
+}
@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package kibana talks to the parts of Kibana's API the installers need,
+// currently just resolving the Fleet enrollment parameters for an agent.
+package kibana
+
+import (
+	"fmt"
+	"os"
+)
+
+// FleetConfig holds the parameters an elastic-agent needs to enroll into Fleet.
+type FleetConfig struct {
+	URL   string
+	Token string
+}
+
+// NewFleetConfig builds a FleetConfig for enrolling with token, resolving the
+// Fleet Server URL from the FLEET_URL environment variable.
+func NewFleetConfig(token string) (*FleetConfig, error) {
+	url := os.Getenv("FLEET_URL")
+	if url == "" {
+		return nil, fmt.Errorf("FLEET_URL must be set to enroll an agent into Fleet")
+	}
+
+	return &FleetConfig{URL: url, Token: token}, nil
+}
+
+// Flags returns the elastic-agent "install" subcommand flags that enroll the
+// agent using this configuration.
+func (cfg *FleetConfig) Flags() []string {
+	return []string{
+		"--url=" + cfg.URL,
+		"--enrollment-token=" + cfg.Token,
+		"--insecure",
+		"--force",
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package progress
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// jsonWriter emits one JSON object per event, for downstream tooling that wants
+// to ingest structured per-service timing data instead of parsing log lines.
+type jsonWriter struct {
+	encoder *json.Encoder
+}
+
+func newJSONWriter() Writer {
+	return &jsonWriter{encoder: json.NewEncoder(os.Stdout)}
+}
+
+func (w *jsonWriter) Event(e Event) {
+	errText := ""
+	if e.Err != nil {
+		errText = e.Err.Error()
+	}
+
+	_ = w.encoder.Encode(struct {
+		ID     string      `json:"id"`
+		Status EventStatus `json:"status"`
+		Text   string      `json:"text,omitempty"`
+		Bytes  int64       `json:"bytes,omitempty"`
+		Total  int64       `json:"total,omitempty"`
+		Error  string      `json:"error,omitempty"`
+	}{
+		ID:     e.ID,
+		Status: e.Status,
+		Text:   e.Text,
+		Bytes:  e.Bytes,
+		Total:  e.Total,
+		Error:  errText,
+	})
+}
+
+func (w *jsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package progress
+
+import (
+	"fmt"
+	"os"
+)
+
+// plainWriter prints one line per event, in the order they arrive. It never
+// repaints a line, which makes it safe for CI systems like Jenkins that don't
+// understand terminal escape sequences.
+type plainWriter struct{}
+
+func newPlainWriter() Writer {
+	return &plainWriter{}
+}
+
+func (w *plainWriter) Event(e Event) {
+	switch e.Status {
+	case StatusStart:
+		fmt.Fprintf(os.Stdout, "%s: %s\n", e.ID, orDefault(e.Text, "starting"))
+	case StatusUpdate:
+		if e.Total > 0 {
+			fmt.Fprintf(os.Stdout, "%s: %d/%d bytes\n", e.ID, e.Bytes, e.Total)
+		} else {
+			fmt.Fprintf(os.Stdout, "%s: %d bytes\n", e.ID, e.Bytes)
+		}
+	case StatusDone:
+		fmt.Fprintf(os.Stdout, "%s: %s\n", e.ID, orDefault(e.Text, "done"))
+	case StatusError:
+		fmt.Fprintf(os.Stderr, "%s: error: %v\n", e.ID, e.Err)
+	}
+}
+
+func (w *plainWriter) Close() error {
+	return nil
+}
+
+func orDefault(text, fallback string) string {
+	if text == "" {
+		return fallback
+	}
+	return text
+}
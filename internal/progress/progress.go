@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package progress provides a pluggable way to report the progress of long
+// running operations -- compose lifecycle changes and artifact downloads --
+// borrowing the printer pattern Compose v2 uses for build output, so that the
+// same event stream can be rendered as a live TTY view, a CI-friendly log, or
+// machine-readable JSON.
+package progress
+
+import (
+	"os"
+	"strings"
+)
+
+// EventStatus describes the stage a unit of work is in.
+type EventStatus string
+
+// Event statuses emitted by a Writer's callers.
+const (
+	StatusStart  EventStatus = "start"
+	StatusUpdate EventStatus = "update"
+	StatusDone   EventStatus = "done"
+	StatusError  EventStatus = "error"
+)
+
+// Event represents a single progress update for a named unit of work, e.g. a
+// compose service coming up or an artifact being downloaded.
+type Event struct {
+	// ID identifies the unit of work this event belongs to, e.g. a service or
+	// artifact name. Writers use it to find/update the right status line.
+	ID     string
+	Status EventStatus
+	Text   string
+
+	// Bytes/Total are only meaningful for StatusUpdate events reporting download
+	// progress; Total is 0 when the size isn't known upfront.
+	Bytes int64
+	Total int64
+
+	Err error
+}
+
+// Writer renders a stream of Events. Implementations must be safe to call from
+// a single goroutine per operation; callers are not expected to emit events
+// concurrently for the same ID.
+type Writer interface {
+	Event(e Event)
+	Close() error
+}
+
+// NewWriter returns the Writer for the given mode ("tty", "plain" or "json"). An
+// empty mode falls back to the OP_PROGRESS environment variable, defaulting to
+// "plain" when that isn't set either, which is the safest choice for CI logs.
+func NewWriter(mode string) Writer {
+	if mode == "" {
+		mode = os.Getenv("OP_PROGRESS")
+	}
+
+	switch strings.ToLower(mode) {
+	case "tty":
+		return newTTYWriter()
+	case "json":
+		return newJSONWriter()
+	default:
+		return newPlainWriter()
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package progress
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ttyWriter keeps one live status line per ID, rewriting it in place as events
+// arrive, the same way "docker compose up" reports "pulling"/"up"/"healthy" for
+// each service without scrolling the terminal.
+type ttyWriter struct {
+	mu    sync.Mutex
+	lines map[string]int
+	next  int
+}
+
+func newTTYWriter() Writer {
+	return &ttyWriter{lines: map[string]int{}}
+}
+
+func (w *ttyWriter) Event(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line, ok := w.lines[e.ID]
+	if !ok {
+		line = w.next
+		w.lines[e.ID] = line
+		w.next++
+		fmt.Fprintln(os.Stdout)
+	}
+
+	status := string(e.Status)
+	if e.Status == StatusUpdate && e.Total > 0 {
+		status = fmt.Sprintf("%s (%d/%d bytes)", e.Text, e.Bytes, e.Total)
+	} else if e.Text != "" {
+		status = e.Text
+	}
+	if e.Status == StatusError {
+		status = fmt.Sprintf("error: %v", e.Err)
+	}
+
+	rows := w.next - line
+	fmt.Fprintf(os.Stdout, "\033[%dA\r\033[K%s: %s\033[%dB\r", rows, e.ID, status, rows)
+}
+
+func (w *ttyWriter) Close() error {
+	fmt.Fprintln(os.Stdout)
+	return nil
+}
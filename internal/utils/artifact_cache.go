@@ -0,0 +1,423 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package utils
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/internal/progress"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// ArtifactCache is a content-addressable, on-disk cache for downloaded artifacts,
+// keyed by (artifact, version, os, arch, extension, snapshot), so the same
+// multi-hundred-MB elastic-agent tarball isn't re-downloaded by every scenario.
+type ArtifactCache struct {
+	dir      string
+	maxBytes int64
+	offline  bool
+
+	mu    sync.Mutex
+	index map[string]cacheEntry
+
+	group singleflight.Group
+}
+
+// cacheEntry is the index record for a single cached artifact.
+type cacheEntry struct {
+	Key        string `json:"key"`
+	SHA512     string `json:"sha512"`
+	Size       int64  `json:"size"`
+	AccessedAt int64  `json:"accessedAt"`
+}
+
+var (
+	defaultCache     *ArtifactCache
+	defaultCacheOnce sync.Once
+)
+
+// DefaultArtifactCache returns the process-wide ArtifactCache, rooted at
+// ~/.op/cache/artifacts and configured from the OP_CACHE_MAX_BYTES and
+// OP_OFFLINE environment variables.
+func DefaultArtifactCache() *ArtifactCache {
+	defaultCacheOnce.Do(func() {
+		cache, err := newArtifactCache()
+		if err != nil {
+			log.WithField("error", err).Fatal("Could not initialise artifact cache")
+		}
+		defaultCache = cache
+	})
+
+	return defaultCache
+}
+
+func newArtifactCache() (*ArtifactCache, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("Could not resolve home directory: %v", err)
+	}
+
+	dir := filepath.Join(usr.HomeDir, ".op", "cache", "artifacts")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Could not create artifact cache directory %s: %v", dir, err)
+	}
+
+	maxBytes := int64(0)
+	if v := os.Getenv("OP_CACHE_MAX_BYTES"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err == nil {
+			maxBytes = parsed
+		}
+	}
+
+	c := &ArtifactCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		offline:  strings.ToUpper(os.Getenv("OP_OFFLINE")) == "TRUE",
+		index:    map[string]cacheEntry{},
+	}
+
+	c.loadIndex()
+
+	return c, nil
+}
+
+// Get returns the local path to binaryName, downloading and verifying it first
+// if it's not already cached. Concurrent callers asking for the same artifact
+// coalesce onto a single download. If writer is non-nil, a StatusUpdate event is
+// emitted for binaryName as the download progresses; writer is ignored on a
+// cache hit, since nothing is downloaded, and when the call joins a download
+// already in flight, whose events go to the first caller's writer only.
+func (c *ArtifactCache) Get(binaryName string, downloadURL string, writer progress.Writer) (string, error) {
+	v, err, _ := c.group.Do(binaryName, func() (interface{}, error) {
+		return c.get(binaryName, downloadURL, writer)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
+
+// Prewarm downloads each of the given (binaryName, downloadURL) pairs
+// concurrently, so that CI can fetch artifacts before parallel test runs start.
+func (c *ArtifactCache) Prewarm(artifacts map[string]string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(artifacts))
+
+	i := 0
+	for binaryName, downloadURL := range artifacts {
+		wg.Add(1)
+		go func(i int, binaryName, downloadURL string) {
+			defer wg.Done()
+			_, err := c.Get(binaryName, downloadURL, nil)
+			errs[i] = err
+		}(i, binaryName, downloadURL)
+		i++
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ArtifactCache) get(binaryName string, downloadURL string, writer progress.Writer) (string, error) {
+	c.mu.Lock()
+	entry, found := c.index[binaryName]
+	c.mu.Unlock()
+
+	if found {
+		path := c.contentPath(entry.SHA512)
+		if fileExists(path) {
+			c.touch(binaryName, entry)
+			log.WithField("artifact", binaryName).Debug("Artifact cache hit")
+			return path, nil
+		}
+	}
+
+	if c.offline {
+		return "", fmt.Errorf("Artifact %s is not cached and OP_OFFLINE is set", binaryName)
+	}
+
+	sha512Sum, err := c.fetchChecksum(downloadURL + ".sha512")
+	if err != nil {
+		return "", err
+	}
+
+	destination := c.contentPath(sha512Sum)
+	if fileExists(destination) {
+		c.mu.Lock()
+		c.index[binaryName] = cacheEntry{Key: binaryName, SHA512: sha512Sum, Size: fileSize(destination), AccessedAt: time.Now().Unix()}
+		c.saveIndex()
+		c.mu.Unlock()
+		return destination, nil
+	}
+
+	path, err := c.download(binaryName, downloadURL, sha512Sum, writer)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.index[binaryName] = cacheEntry{Key: binaryName, SHA512: sha512Sum, Size: fileSize(path), AccessedAt: time.Now().Unix()}
+	c.evictIfNeeded(binaryName)
+	c.saveIndex()
+	c.mu.Unlock()
+
+	return path, nil
+}
+
+// download fetches downloadURL into a ".part" file, resuming from where a
+// previous, interrupted download left off, then verifies it against
+// expectedSHA512 before moving it into its content-addressable location. If
+// writer is non-nil, it receives a StatusUpdate event per chunk read off the
+// network, reporting the bytes of the artifact on disk so far against its total
+// size (the bytes already in the ".part" file plus the response's Content-Length).
+func (c *ArtifactCache) download(binaryName, downloadURL, expectedSHA512 string, writer progress.Writer) (string, error) {
+	partPath := filepath.Join(c.dir, binaryName+".part")
+
+	var resumeFrom int64
+	if info, err := os.Stat(partPath); err == nil {
+		resumeFrom = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("Could not build request for %s: %v", downloadURL, err)
+	}
+	if resumeFrom > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Could not download %s: %v", downloadURL, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if resp.StatusCode == http.StatusPartialContent {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+		resumeFrom = 0
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return "", fmt.Errorf("Could not open %s: %v", partPath, err)
+	}
+	defer f.Close()
+
+	total := resumeFrom + resp.ContentLength
+	if resp.ContentLength < 0 {
+		total = 0
+	}
+
+	body := io.Reader(resp.Body)
+	if writer != nil {
+		body = &progressReader{r: resp.Body, id: binaryName, bytes: resumeFrom, total: total, writer: writer}
+	}
+
+	if _, err := io.Copy(f, body); err != nil {
+		return "", fmt.Errorf("Could not write %s: %v", partPath, err)
+	}
+
+	sum, err := sha512File(partPath)
+	if err != nil {
+		return "", err
+	}
+	if sum != expectedSHA512 {
+		os.Remove(partPath)
+		return "", fmt.Errorf("Checksum mismatch for %s: expected %s, got %s", binaryName, expectedSHA512, sum)
+	}
+
+	destination := c.contentPath(sum)
+	if err := os.Rename(partPath, destination); err != nil {
+		return "", fmt.Errorf("Could not move %s into cache: %v", partPath, err)
+	}
+
+	return destination, nil
+}
+
+// progressReader wraps an io.Reader, emitting a StatusUpdate event on writer
+// after every Read so callers can report live download progress.
+type progressReader struct {
+	r      io.Reader
+	id     string
+	bytes  int64
+	total  int64
+	writer progress.Writer
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.bytes += int64(n)
+		p.writer.Event(progress.Event{
+			ID:     p.id,
+			Status: progress.StatusUpdate,
+			Bytes:  p.bytes,
+			Total:  p.total,
+		})
+	}
+	return n, err
+}
+
+func (c *ArtifactCache) fetchChecksum(sha512URL string) (string, error) {
+	resp, err := http.Get(sha512URL)
+	if err != nil {
+		return "", fmt.Errorf("Could not fetch checksum %s: %v", sha512URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("Could not read checksum %s: %v", sha512URL, err)
+	}
+
+	// the published sidecar is "<sha512>  <filename>"
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("Empty checksum file at %s", sha512URL)
+	}
+
+	return fields[0], nil
+}
+
+func (c *ArtifactCache) contentPath(sha512Sum string) string {
+	return filepath.Join(c.dir, sha512Sum)
+}
+
+func (c *ArtifactCache) touch(binaryName string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.AccessedAt = time.Now().Unix()
+	c.index[binaryName] = entry
+	c.saveIndex()
+}
+
+// evictIfNeeded removes the least-recently-accessed artifacts until the cache is
+// back under maxBytes, never evicting keep, which is the artifact get() is about
+// to return -- otherwise a single large artifact (or a too-small
+// OP_CACHE_MAX_BYTES) could have its own file deleted in the same call that just
+// downloaded it. Callers must hold c.mu.
+func (c *ArtifactCache) evictIfNeeded(keep string) {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	var total int64
+	for _, entry := range c.index {
+		total += entry.Size
+	}
+	if total <= c.maxBytes {
+		return
+	}
+
+	entries := make([]cacheEntry, 0, len(c.index))
+	for _, entry := range c.index {
+		if entry.Key == keep {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].AccessedAt < entries[j].AccessedAt })
+
+	for _, entry := range entries {
+		if total <= c.maxBytes {
+			break
+		}
+
+		os.Remove(c.contentPath(entry.SHA512))
+		delete(c.index, entry.Key)
+		total -= entry.Size
+
+		log.WithFields(log.Fields{
+			"artifact": entry.Key,
+			"bytes":    entry.Size,
+		}).Debug("Evicted artifact from cache")
+	}
+}
+
+func (c *ArtifactCache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+func (c *ArtifactCache) loadIndex() {
+	content, err := os.ReadFile(c.indexPath())
+	if err != nil {
+		return
+	}
+
+	var index map[string]cacheEntry
+	if err := json.Unmarshal(content, &index); err != nil {
+		log.WithField("error", err).Warn("Could not parse artifact cache index, starting fresh")
+		return
+	}
+
+	c.index = index
+}
+
+// saveIndex persists the index. Callers must hold c.mu.
+func (c *ArtifactCache) saveIndex() {
+	content, err := json.Marshal(c.index)
+	if err != nil {
+		log.WithField("error", err).Warn("Could not marshal artifact cache index")
+		return
+	}
+
+	if err := os.WriteFile(c.indexPath(), content, 0644); err != nil {
+		log.WithField("error", err).Warn("Could not persist artifact cache index")
+	}
+}
+
+func sha512File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("Could not open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("Could not hash %s: %v", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
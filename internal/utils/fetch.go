@@ -0,0 +1,25 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/elastic/e2e-testing/internal/progress"
+)
+
+// artifactsBaseURL is where Elastic publishes beats/elastic-agent artifacts,
+// including the sha512 sidecar file FetchBeatsBinary verifies against.
+const artifactsBaseURL = "https://artifacts-snapshot.elastic.co/beats"
+
+// FetchBeatsBinary resolves binaryName through the DefaultArtifactCache,
+// downloading and verifying it only on a cache miss, instead of redownloading
+// the multi-hundred-MB artifact for every scenario that needs it. If writer is
+// non-nil, it receives StatusUpdate events reporting download progress.
+func FetchBeatsBinary(binaryName, artifact, version, versionBase string, timeoutFactor int, downloadOnly bool, writer progress.Writer) (string, error) {
+	downloadURL := fmt.Sprintf("%s/%s/%s/%s", artifactsBaseURL, artifact, versionBase, binaryName)
+
+	return DefaultArtifactCache().Get(binaryName, downloadURL, writer)
+}
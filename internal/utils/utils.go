@@ -0,0 +1,35 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package utils contains helpers shared by the installers: artifact naming,
+// architecture detection and the artifact download/cache machinery.
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TimeoutFactor is the timeout multiplier the installers pass to
+// FetchBeatsBinary. It is fixed at 3 and not read from the environment, and
+// FetchBeatsBinary does not apply it to the download.
+var TimeoutFactor = 3
+
+// GetArchitecture returns the runtime architecture as the Go runtime names it
+// ("amd64", "arm64", ...). For amd64 this differs from the artifact server's
+// naming, which uses "x86_64".
+func GetArchitecture() string {
+	return runtime.GOARCH
+}
+
+// BuildArtifactName returns the file name of a published Elastic artifact, e.g.
+// "elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz".
+func BuildArtifactName(artifact, version, versionBase, os, arch, extension string, snapshot bool) string {
+	v := version
+	if snapshot {
+		v = fmt.Sprintf("%s-SNAPSHOT", versionBase)
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s.%s", artifact, v, os, arch, extension)
+}